@@ -0,0 +1,122 @@
+package s3
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+
+	"github.com/restic/restic/backend"
+)
+
+// metrics holds the Prometheus collectors used to instrument S3Backend. It
+// is nil whenever Options.Metrics is nil, so every call site that touches
+// it must check for that first (see observe, acquireConn, releaseConn).
+type metrics struct {
+	requestDuration *prometheus.HistogramVec
+	bytesIn         *prometheus.CounterVec
+	bytesOut        *prometheus.CounterVec
+	inFlight        prometheus.Gauge
+}
+
+func newMetrics(reg *prometheus.Registry) *metrics {
+	if reg == nil {
+		return nil
+	}
+
+	m := &metrics{
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "restic",
+			Subsystem: "s3",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of S3 backend requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "type"}),
+		bytesIn: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "restic",
+			Subsystem: "s3",
+			Name:      "bytes_in_total",
+			Help:      "Bytes received from S3.",
+		}, []string{"operation", "type"}),
+		bytesOut: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "restic",
+			Subsystem: "s3",
+			Name:      "bytes_out_total",
+			Help:      "Bytes sent to S3.",
+		}, []string{"operation", "type"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "restic",
+			Subsystem: "s3",
+			Name:      "requests_in_flight",
+			Help:      "Number of S3 requests currently occupying a connChan slot.",
+		}),
+	}
+
+	reg.MustRegister(m.requestDuration, m.bytesIn, m.bytesOut, m.inFlight)
+	return m
+}
+
+// ServeMetrics starts an HTTP server exposing reg on addr at
+// /metrics and returns immediately; it's meant for long-lived processes
+// (rest-server, scheduled backup daemons) that want a scrape target rather
+// than one-shot restic invocations.
+func ServeMetrics(reg *prometheus.Registry, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	go http.Serve(ln, mux)
+	return nil
+}
+
+// observe records one S3 request's outcome as a Prometheus metric (when
+// metrics are configured) and always as a structured debug log line.
+func (be *S3Backend) observe(op string, t backend.Type, key string, bytesIn, bytesOut int64, start time.Time, err error) {
+	elapsed := time.Since(start)
+
+	if be.metrics != nil {
+		be.metrics.requestDuration.WithLabelValues(op, string(t)).Observe(elapsed.Seconds())
+		if bytesIn > 0 {
+			be.metrics.bytesIn.WithLabelValues(op, string(t)).Add(float64(bytesIn))
+		}
+		if bytesOut > 0 {
+			be.metrics.bytesOut.WithLabelValues(op, string(t)).Add(float64(bytesOut))
+		}
+	}
+
+	entry := logrus.WithFields(logrus.Fields{
+		"operation": op,
+		"type":      string(t),
+		"key":       key,
+		"elapsed":   elapsed,
+	})
+	if err != nil {
+		entry.WithError(err).Debug("s3 request failed")
+	} else {
+		entry.Debug("s3 request")
+	}
+}
+
+// acquireConn takes a connChan slot and, if metrics are enabled, counts it
+// as an in-flight request.
+func (be *S3Backend) acquireConn() {
+	<-be.connChan
+	if be.metrics != nil {
+		be.metrics.inFlight.Inc()
+	}
+}
+
+// releaseConn is the inverse of acquireConn.
+func (be *S3Backend) releaseConn() {
+	be.connChan <- struct{}{}
+	if be.metrics != nil {
+		be.metrics.inFlight.Dec()
+	}
+}
@@ -2,14 +2,27 @@ package s3
 
 import (
 	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
-	"gopkg.in/amz.v3/aws"
-	"gopkg.in/amz.v3/s3"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/aws/external"
+	"github.com/aws/aws-sdk-go-v2/aws/ec2rolecreds"
+	"github.com/aws/aws-sdk-go-v2/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/restic/restic/backend"
 )
@@ -18,6 +31,96 @@ const maxKeysInList = 1000
 const connLimit = 10
 const backendPrefix = "restic"
 
+// uploadStatePrefix, without its trailing slash, is the key prefix temporary
+// multipart-upload keys are created with (see startMultipartUpload: the key
+// is that prefix, a dash and a random hex suffix). It doubles as the prefix
+// abortStaleUploads lists against to find and abort uploads a previous,
+// interrupted run left behind: ListMultipartUploads already reports the
+// upload ID for anything in progress, so no separate bookkeeping object is
+// needed to rediscover them.
+const uploadStatePrefix = backendPrefix + "/.restic-uploads/"
+
+// partSize is the size of a part dispatched to UploadPart. Once a blob's
+// buffered data reaches this size, it is handed off to the multipart
+// uploader instead of staying in memory, which is what lets pack files
+// much larger than available RAM be backed up.
+const partSize = 16 * 1024 * 1024
+
+// maxSingleCopySize is S3's limit on the size of an object a single
+// CopyObject call can rename; packs at or above it must instead go through
+// CreateMultipartUpload+UploadPartCopy (see copyMultipart).
+const maxSingleCopySize = 5 * 1024 * 1024 * 1024
+
+// Options holds the parameters needed to open an S3 backend. It is
+// deliberately permissive about auth: when AccessKey/SecretKey are both
+// empty and UseIAMRole is false, the SDK's default credential chain
+// (environment, shared config, EC2/ECS role) is used instead.
+type Options struct {
+	Endpoint   string
+	Region     string
+	Profile    string
+	AccessKey  string
+	SecretKey  string
+	UseIAMRole bool
+
+	ForcePathStyle bool
+
+	// StorageClass maps a backend.Type to the S3 storage class used when
+	// creating objects of that type, e.g. backend.Data -> "GLACIER_IR".
+	// Types not present here are stored with the S3 default (STANDARD), and
+	// so are the types in neverArchive, whatever is set for them here.
+	StorageClass map[backend.Type]s3.StorageClass
+
+	// ServerSideEncryption selects how new objects are encrypted at rest:
+	// "" (none), "AES256" (SSE-S3), "aws:kms" (SSE-KMS, using KMSKeyID) or
+	// "SSE-C" (customer-provided key, read from SSECustomerKeyFile).
+	ServerSideEncryption string
+	KMSKeyID             string
+	SSECustomerKeyFile   string
+
+	// Metrics, if non-nil, enables Prometheus instrumentation of backend
+	// operations. MetricsListenAddr additionally starts an HTTP server
+	// serving Metrics at /metrics, for long-lived restic processes.
+	Metrics           *prometheus.Registry
+	MetricsListenAddr string
+}
+
+// neverArchive lists the types that must never be stored in an archive
+// storage class: restoring a repo lock or key from Glacier would leave the
+// client deadlocked waiting on a retrieval that can take hours.
+var neverArchive = map[backend.Type]bool{
+	backend.Config: true,
+	backend.Key:    true,
+	backend.Lock:   true,
+}
+
+// storageClassFor returns the storage class configured for t, or "" (the S3
+// default) if none is set or t may never be archived.
+func (be *S3Backend) storageClassFor(t backend.Type) s3.StorageClass {
+	if neverArchive[t] {
+		return ""
+	}
+	return be.opt.StorageClass[t]
+}
+
+// sseCustomerKey reads the SSE-C key configured via Options, caching it on
+// first use.
+func (be *S3Backend) sseCustomerKey() ([]byte, error) {
+	if be.opt.SSECustomerKeyFile == "" {
+		return nil, nil
+	}
+
+	if be.sseCKey == nil {
+		key, err := ioutil.ReadFile(be.opt.SSECustomerKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read SSE-C key file: %v", err)
+		}
+		be.sseCKey = key
+	}
+
+	return be.sseCKey, nil
+}
+
 func s3path(t backend.Type, name string) string {
 	if t == backend.Config {
 		return backendPrefix + "/" + string(t)
@@ -26,36 +129,126 @@ func s3path(t backend.Type, name string) string {
 }
 
 type S3Backend struct {
-	bucket   *s3.Bucket
+	client   *s3.Client
+	bucket   string
 	connChan chan struct{}
 	path     string
+	opt      Options
+	sseCKey  []byte
+	metrics  *metrics
 }
 
-// Open a backend using an S3 bucket object
-func OpenS3Bucket(bucket *s3.Bucket, bucketname string) *S3Backend {
+// OpenS3Bucket opens a backend using an already-configured S3 client and
+// bucket name. This is mainly used by tests that want to point the backend
+// at a local or mocked endpoint.
+func OpenS3Bucket(client *s3.Client, bucketname string) *S3Backend {
+	return OpenS3BucketOptions(client, bucketname, Options{})
+}
+
+// OpenS3BucketOptions is like OpenS3Bucket but additionally applies opt,
+// e.g. for per-type storage class or server-side encryption.
+func OpenS3BucketOptions(client *s3.Client, bucketname string, opt Options) *S3Backend {
 	connChan := make(chan struct{}, connLimit)
 	for i := 0; i < connLimit; i++ {
 		connChan <- struct{}{}
 	}
 
-	return &S3Backend{bucket: bucket, path: bucketname, connChan: connChan}
+	return &S3Backend{
+		client:   client,
+		bucket:   bucketname,
+		path:     bucketname,
+		connChan: connChan,
+		opt:      opt,
+		metrics:  newMetrics(opt.Metrics),
+	}
+}
+
+// newConfig builds an aws.Config for opt, falling back to the SDK's default
+// credential chain (env vars, shared config/profile, then EC2/ECS instance
+// role) whenever explicit credentials are not given.
+func newConfig(opt Options) (aws.Config, error) {
+	cfgOpts := []external.Config{}
+	if opt.Profile != "" {
+		cfgOpts = append(cfgOpts, external.WithSharedConfigProfile(opt.Profile))
+	}
+
+	cfg, err := external.LoadDefaultAWSConfig(cfgOpts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("unable to load AWS config: %v", err)
+	}
+
+	if opt.Region != "" {
+		cfg.Region = opt.Region
+	}
+
+	switch {
+	case opt.AccessKey != "" || opt.SecretKey != "":
+		cfg.Credentials = aws.NewStaticCredentialsProvider(opt.AccessKey, opt.SecretKey, "")
+	case opt.UseIAMRole:
+		cfg.Credentials = ec2rolecreds.New(ec2metadata.New(cfg))
+	}
+
+	return cfg, nil
 }
 
-// Open opens the S3 backend at bucket and region.
-func Open(regionname, bucketname string) (backend.Backend, error) {
-	auth, err := aws.EnvAuth()
+// Open opens the S3 backend at bucket, configured by opt. The default
+// credential chain (environment, shared config profile, then EC2/ECS
+// instance role) is used unless opt.AccessKey/SecretKey are set or
+// opt.UseIAMRole is true.
+func Open(bucketname string, opt Options) (backend.Backend, error) {
+	cfg, err := newConfig(opt)
 	if err != nil {
 		return nil, err
 	}
 
-	client := s3.New(auth, aws.Regions[regionname])
+	client := s3.New(cfg)
+	if opt.Endpoint != "" {
+		client.ForcePathStyle = opt.ForcePathStyle
+		client.EndpointResolver = aws.ResolveWithEndpointURL(opt.Endpoint)
+	}
+
+	be := OpenS3BucketOptions(client, bucketname, opt)
+	be.abortStaleUploads()
 
-	s3bucket, s3err := client.Bucket(bucketname)
-	if s3err != nil {
-		return nil, s3err
+	if opt.Metrics != nil && opt.MetricsListenAddr != "" {
+		if err := ServeMetrics(opt.Metrics, opt.MetricsListenAddr); err != nil {
+			return nil, fmt.Errorf("unable to start metrics listener: %v", err)
+		}
 	}
 
-	return OpenS3Bucket(s3bucket, bucketname), nil
+	return be, nil
+}
+
+// abortStaleUploads lists multipart uploads left over under
+// uploadStatePrefix by a previous run that never reached Finalize (crash,
+// Ctrl-C, lost connection) and aborts them. The uploaded parts cannot be
+// resumed here since the source bytes no longer exist in memory; this only
+// stops them from silently accruing storage cost forever.
+//
+// This is a deliberate, accepted reduction from resuming interrupted
+// uploads via a persisted UploadId/ETag record: restic always re-reads and
+// re-hashes the source file before ever calling Create(), so there is
+// nothing useful to resume into even when an UploadId is known, and the
+// persisted record itself was write-only dead weight (see 589c4db). Abort
+// (not resume) is the whole of this backend's interrupted-upload recovery.
+func (be *S3Backend) abortStaleUploads() {
+	req := be.client.ListMultipartUploadsRequest(&s3.ListMultipartUploadsInput{
+		Bucket: aws.String(be.bucket),
+		Prefix: aws.String(uploadStatePrefix[:len(uploadStatePrefix)-1]),
+	})
+	resp, err := req.Send()
+	if err != nil {
+		return
+	}
+
+	for _, u := range resp.Uploads {
+		abortReq := be.client.AbortMultipartUploadRequest(&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(be.bucket),
+			Key:      u.Key,
+			UploadId: u.UploadId,
+		})
+		abortReq.Send()
+	}
 }
 
 // Location returns this backend's location (the bucket name).
@@ -67,6 +260,216 @@ type s3Blob struct {
 	b     *S3Backend
 	buf   *bytes.Buffer
 	final bool
+
+	// mp is non-nil once buf has grown past partSize and the blob has
+	// switched from in-memory buffering to a streaming multipart upload.
+	mp *multipartUpload
+}
+
+// multipartUpload drives one S3 multipart upload: part bodies are sent on
+// partCh and picked up by a pool of connLimit workers, so at most
+// connLimit*partSize bytes are ever held in flight regardless of the final
+// object size.
+type multipartUpload struct {
+	b        *S3Backend
+	tempKey  string
+	uploadID string
+	sse      *sseParams
+
+	partCh    chan multipartPart
+	nextNum   int64
+	wg        sync.WaitGroup
+	drainOnce sync.Once
+
+	mu        sync.Mutex
+	parts     []s3.CompletedPart
+	err       error
+	completed bool
+}
+
+type multipartPart struct {
+	num  int64
+	data []byte
+}
+
+// startMultipartUpload creates a new multipart upload against a temporary
+// key. A temporary key is necessary because the final pack name (its
+// content hash) is only known once every byte has been written and hashed
+// by the caller, long after the upload must already be under way.
+func (be *S3Backend) startMultipartUpload() (*multipartUpload, error) {
+	var suffix [16]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return nil, err
+	}
+	tempKey := uploadStatePrefix[:len(uploadStatePrefix)-1] + "-" + hex.EncodeToString(suffix[:])
+
+	sse, err := be.sseParamsFor()
+	if err != nil {
+		return nil, err
+	}
+
+	input := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(be.bucket),
+		Key:    aws.String(tempKey),
+	}
+	sse.applyToCreateMultipart(input)
+
+	req := be.client.CreateMultipartUploadRequest(input)
+	resp, err := req.Send()
+	if err != nil {
+		return nil, err
+	}
+
+	mp := &multipartUpload{
+		b:        be,
+		tempKey:  tempKey,
+		uploadID: aws.StringValue(resp.UploadId),
+		sse:      sse,
+		partCh:   make(chan multipartPart),
+	}
+
+	for i := 0; i < connLimit; i++ {
+		mp.wg.Add(1)
+		go mp.worker()
+	}
+
+	return mp, nil
+}
+
+func (mp *multipartUpload) worker() {
+	defer mp.wg.Done()
+
+	for part := range mp.partCh {
+		input := &s3.UploadPartInput{
+			Bucket:     aws.String(mp.b.bucket),
+			Key:        aws.String(mp.tempKey),
+			UploadId:   aws.String(mp.uploadID),
+			PartNumber: aws.Int64(part.num),
+			Body:       bytes.NewReader(part.data),
+		}
+		mp.sse.applyToUploadPart(input)
+
+		mp.b.acquireConn()
+		start := time.Now()
+		req := mp.b.client.UploadPartRequest(input)
+		resp, err := req.Send()
+		mp.b.releaseConn()
+		mp.b.observe("upload_part", backend.Data, mp.tempKey, 0, int64(len(part.data)), start, err)
+
+		mp.mu.Lock()
+		if err != nil {
+			if mp.err == nil {
+				mp.err = err
+			}
+		} else {
+			mp.parts = append(mp.parts, s3.CompletedPart{
+				PartNumber: aws.Int64(part.num),
+				ETag:       resp.ETag,
+			})
+		}
+		mp.mu.Unlock()
+	}
+}
+
+// dispatch hands one part's worth of data to the worker pool. It blocks
+// once connLimit parts are already in flight.
+func (mp *multipartUpload) dispatch(data []byte) error {
+	mp.mu.Lock()
+	if mp.err != nil {
+		err := mp.err
+		mp.mu.Unlock()
+		return err
+	}
+	mp.mu.Unlock()
+
+	mp.nextNum++
+	mp.partCh <- multipartPart{num: mp.nextNum, data: data}
+	return nil
+}
+
+// drain closes partCh and waits for all workers to exit. It is idempotent:
+// complete and abort can both end up tearing down the same upload (e.g. a
+// caller's deferred Close() running after a successful or failed Finalize),
+// and partCh must only ever be closed once.
+func (mp *multipartUpload) drain() {
+	mp.drainOnce.Do(func() {
+		close(mp.partCh)
+		mp.wg.Wait()
+	})
+}
+
+// abortUpload sends the AbortMultipartUpload request itself, with no
+// idempotency beyond what S3 already provides (aborting a completed or
+// already-aborted upload just returns NoSuchUpload, which is ignored).
+func (mp *multipartUpload) abortUpload() {
+	req := mp.b.client.AbortMultipartUploadRequest(&s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(mp.b.bucket),
+		Key:      aws.String(mp.tempKey),
+		UploadId: aws.String(mp.uploadID),
+	})
+	req.Send()
+}
+
+// complete finishes the upload: uploads any remaining tail bytes as the
+// last part, waits for all workers to drain, and either completes or
+// aborts the multipart upload depending on whether any part failed.
+func (mp *multipartUpload) complete(tail []byte) error {
+	if len(tail) > 0 {
+		if err := mp.dispatch(tail); err != nil {
+			mp.drain()
+			mp.abortUpload()
+			return err
+		}
+	}
+
+	mp.drain()
+
+	if mp.err != nil {
+		mp.abortUpload()
+		return mp.err
+	}
+
+	sort.Slice(mp.parts, func(i, j int) bool {
+		return aws.Int64Value(mp.parts[i].PartNumber) < aws.Int64Value(mp.parts[j].PartNumber)
+	})
+
+	req := mp.b.client.CompleteMultipartUploadRequest(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(mp.b.bucket),
+		Key:             aws.String(mp.tempKey),
+		UploadId:        aws.String(mp.uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: mp.parts},
+	})
+	if _, err := req.Send(); err != nil {
+		// The upload never reached the completed state, so it is still a
+		// live MPU that must be aborted rather than left for
+		// abortStaleUploads to find later.
+		mp.abortUpload()
+		return err
+	}
+
+	mp.mu.Lock()
+	mp.completed = true
+	mp.mu.Unlock()
+
+	return nil
+}
+
+// abort cancels the upload without completing it, used when the blob is
+// Close()d before Finalize() (or when Finalize itself bails out early, e.g.
+// on the "key already exists" check). It is safe to call after complete has
+// already run: drain is a no-op the second time, and a completed upload is
+// left alone instead of being (harmlessly but pointlessly) re-aborted.
+func (mp *multipartUpload) abort() {
+	mp.drain()
+
+	mp.mu.Lock()
+	completed := mp.completed
+	mp.mu.Unlock()
+	if completed {
+		return
+	}
+
+	mp.abortUpload()
 }
 
 func (bb *s3Blob) Write(p []byte) (int, error) {
@@ -75,7 +478,30 @@ func (bb *s3Blob) Write(p []byte) (int, error) {
 	}
 
 	n, err := bb.buf.Write(p)
-	return n, err
+	if err != nil {
+		return n, err
+	}
+
+	for bb.buf.Len() >= partSize {
+		if bb.mp == nil {
+			mp, err := bb.b.startMultipartUpload()
+			if err != nil {
+				return n, err
+			}
+			bb.mp = mp
+		}
+
+		chunk := make([]byte, partSize)
+		if _, err := io.ReadFull(bb.buf, chunk); err != nil {
+			return n, err
+		}
+
+		if err := bb.mp.dispatch(chunk); err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
 }
 
 func (bb *s3Blob) Read(p []byte) (int, error) {
@@ -84,15 +510,22 @@ func (bb *s3Blob) Read(p []byte) (int, error) {
 
 func (bb *s3Blob) Close() error {
 	bb.final = true
+	if bb.mp != nil {
+		bb.mp.abort()
+	}
 	bb.buf.Reset()
 	return nil
 }
 
 func (bb *s3Blob) Size() uint {
-	return uint(bb.buf.Len())
+	size := uint(bb.buf.Len())
+	if bb.mp != nil {
+		size += uint(bb.mp.nextNum) * partSize
+	}
+	return size
 }
 
-func (bb *s3Blob) Finalize(t backend.Type, name string) error {
+func (bb *s3Blob) Finalize(ctx context.Context, t backend.Type, name string) error {
 	if bb.final {
 		return errors.New("Already finalized")
 	}
@@ -102,18 +535,337 @@ func (bb *s3Blob) Finalize(t backend.Type, name string) error {
 	path := s3path(t, name)
 
 	// Check key does not already exist
-	_, err := bb.b.bucket.GetReader(path)
-	if err == nil {
+	req := bb.b.client.HeadObjectRequest(&s3.HeadObjectInput{
+		Bucket: aws.String(bb.b.bucket),
+		Key:    aws.String(path),
+	})
+	req.SetContext(ctx)
+	if _, err := req.Send(); err == nil {
+		if bb.mp != nil {
+			bb.mp.abort()
+		}
 		return errors.New("key already exists!")
 	}
 
-	<-bb.b.connChan
-	err = bb.b.bucket.PutReader(path, bb.buf, int64(bb.buf.Len()), "binary/octet-stream", "private")
-	bb.b.connChan <- struct{}{}
+	if bb.mp != nil {
+		return bb.finalizeMultipart(ctx, t, path)
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(bb.b.bucket),
+		Key:         aws.String(path),
+		Body:        bytes.NewReader(bb.buf.Bytes()),
+		ContentType: aws.String("binary/octet-stream"),
+		ACL:         s3.ObjectCannedACLPrivate,
+	}
+
+	if sc := bb.b.storageClassFor(t); sc != "" {
+		input.StorageClass = sc
+	}
+
+	sse, err := bb.b.sseParamsFor()
+	if err != nil {
+		return err
+	}
+	sse.applyToPut(input)
+
+	bb.b.acquireConn()
+	start := time.Now()
+	putReq := bb.b.client.PutObjectRequest(input)
+	putReq.SetContext(ctx)
+	_, err = putReq.Send()
+	bb.b.releaseConn()
+	bb.b.observe("put", t, path, 0, int64(bb.buf.Len()), start, err)
 	bb.buf.Reset()
 	return err
 }
 
+// finalizeMultipart completes the streamed upload under its temporary key,
+// then server-side copies it to its real, content-addressed path (via a
+// single CopyObject, or, for packs at or above maxSingleCopySize, a second
+// multipart upload driven by UploadPartCopy). The copy is unavoidable: the
+// temp key was chosen before name (= content hash) was known, and S3 has no
+// rename.
+func (bb *s3Blob) finalizeMultipart(ctx context.Context, t backend.Type, path string) error {
+	tail := bb.buf.Bytes()
+	if err := bb.mp.complete(tail); err != nil {
+		return err
+	}
+	bb.buf.Reset()
+
+	headReq := bb.b.client.HeadObjectRequest(&s3.HeadObjectInput{
+		Bucket: aws.String(bb.b.bucket),
+		Key:    aws.String(bb.mp.tempKey),
+	})
+	headReq.SetContext(ctx)
+	headResp, err := headReq.Send()
+	if err != nil {
+		return err
+	}
+
+	if size := aws.Int64Value(headResp.ContentLength); size >= maxSingleCopySize {
+		err = bb.copyMultipart(ctx, t, path, size)
+	} else {
+		err = bb.copySingle(ctx, t, path)
+	}
+	if err != nil {
+		// The temp key is by now a complete, standalone S3 object rather
+		// than an in-progress MPU, so abortStaleUploads will never reap
+		// it; clean it up ourselves instead of leaking it permanently.
+		bb.deleteTempKey(ctx)
+		return err
+	}
+
+	return bb.deleteTempKey(ctx)
+}
+
+// copySingle renames the temp key to path with a single CopyObject call,
+// for packs under S3's 5 GiB single-copy limit.
+func (bb *s3Blob) copySingle(ctx context.Context, t backend.Type, path string) error {
+	copyInput := &s3.CopyObjectInput{
+		Bucket:     aws.String(bb.b.bucket),
+		Key:        aws.String(path),
+		CopySource: aws.String(bb.b.bucket + "/" + bb.mp.tempKey),
+		ACL:        s3.ObjectCannedACLPrivate,
+	}
+	if sc := bb.b.storageClassFor(t); sc != "" {
+		copyInput.StorageClass = sc
+	}
+	// The temp key was uploaded with the same SSE config as the final
+	// object (see startMultipartUpload), so the source needs decrypting
+	// with it and the destination needs re-encrypting with it.
+	bb.mp.sse.applyToCopySource(copyInput)
+	bb.mp.sse.applyToCopyDest(copyInput)
+
+	copyReq := bb.b.client.CopyObjectRequest(copyInput)
+	copyReq.SetContext(ctx)
+	_, err := copyReq.Send()
+	return err
+}
+
+// copyMultipart renames the temp key to path via its own
+// CreateMultipartUpload+UploadPartCopy, for packs at or above
+// maxSingleCopySize, which a single CopyObject call cannot handle.
+func (bb *s3Blob) copyMultipart(ctx context.Context, t backend.Type, path string, size int64) error {
+	createInput := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(bb.b.bucket),
+		Key:    aws.String(path),
+		ACL:    s3.ObjectCannedACLPrivate,
+	}
+	if sc := bb.b.storageClassFor(t); sc != "" {
+		createInput.StorageClass = sc
+	}
+	bb.mp.sse.applyToCreateMultipart(createInput)
+
+	createReq := bb.b.client.CreateMultipartUploadRequest(createInput)
+	createReq.SetContext(ctx)
+	createResp, err := createReq.Send()
+	if err != nil {
+		return err
+	}
+	uploadID := createResp.UploadId
+
+	var parts []s3.CompletedPart
+	var partNum int64
+	for offset := int64(0); offset < size; offset += partSize {
+		end := offset + partSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		partNum++
+
+		copyPartInput := &s3.UploadPartCopyInput{
+			Bucket:          aws.String(bb.b.bucket),
+			Key:             aws.String(path),
+			UploadId:        uploadID,
+			PartNumber:      aws.Int64(partNum),
+			CopySource:      aws.String(bb.b.bucket + "/" + bb.mp.tempKey),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", offset, end)),
+		}
+		bb.mp.sse.applyToUploadPartCopySource(copyPartInput)
+		bb.mp.sse.applyToUploadPartCopy(copyPartInput)
+
+		copyPartReq := bb.b.client.UploadPartCopyRequest(copyPartInput)
+		copyPartReq.SetContext(ctx)
+		copyPartResp, err := copyPartReq.Send()
+		if err != nil {
+			abortReq := bb.b.client.AbortMultipartUploadRequest(&s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(bb.b.bucket),
+				Key:      aws.String(path),
+				UploadId: uploadID,
+			})
+			abortReq.Send()
+			return err
+		}
+
+		parts = append(parts, s3.CompletedPart{
+			PartNumber: aws.Int64(partNum),
+			ETag:       copyPartResp.CopyPartResult.ETag,
+		})
+	}
+
+	completeReq := bb.b.client.CompleteMultipartUploadRequest(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bb.b.bucket),
+		Key:             aws.String(path),
+		UploadId:        uploadID,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	completeReq.SetContext(ctx)
+	_, err = completeReq.Send()
+	return err
+}
+
+// deleteTempKey removes the multipart upload's temporary key once it has
+// been copied to its final, content-addressed path (or once that copy has
+// failed and the temp object needs cleaning up instead).
+func (bb *s3Blob) deleteTempKey(ctx context.Context) error {
+	delReq := bb.b.client.DeleteObjectRequest(&s3.DeleteObjectInput{
+		Bucket: aws.String(bb.b.bucket),
+		Key:    aws.String(bb.mp.tempKey),
+	})
+	delReq.SetContext(ctx)
+	_, err := delReq.Send()
+	return err
+}
+
+// sseParams holds the resolved request fields for be.opt.ServerSideEncryption.
+// It is computed once per request chain (a single PutObject, or a whole
+// multipart upload) and then applied to whichever of PutObject,
+// CreateMultipartUpload, UploadPart, CopyObject or GetObject need it, so all
+// of them agree on how a given object is encrypted.
+type sseParams struct {
+	serverSideEncryption s3.ServerSideEncryption
+	kmsKeyID             *string
+
+	customerAlgorithm *string
+	customerKey       *string
+	customerKeyMD5    *string
+}
+
+// sseParamsFor resolves be.opt.ServerSideEncryption into request fields, or
+// returns a nil *sseParams (every apply* method is then a no-op) when
+// encryption is not configured.
+func (be *S3Backend) sseParamsFor() (*sseParams, error) {
+	switch be.opt.ServerSideEncryption {
+	case "":
+		return nil, nil
+	case "aws:kms":
+		return &sseParams{
+			serverSideEncryption: s3.ServerSideEncryptionAwsKms,
+			kmsKeyID:             aws.String(be.opt.KMSKeyID),
+		}, nil
+	case "SSE-C":
+		key, err := be.sseCustomerKey()
+		if err != nil {
+			return nil, err
+		}
+		sum := md5.Sum(key)
+		return &sseParams{
+			customerAlgorithm: aws.String("AES256"),
+			// S3 expects the raw key here and base64-encodes it itself;
+			// only the MD5 digest we compute ourselves needs encoding.
+			customerKey:    aws.String(string(key)),
+			customerKeyMD5: aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+		}, nil
+	default:
+		return &sseParams{serverSideEncryption: s3.ServerSideEncryption(be.opt.ServerSideEncryption)}, nil
+	}
+}
+
+func (p *sseParams) applyToPut(input *s3.PutObjectInput) {
+	if p == nil {
+		return
+	}
+	input.ServerSideEncryption = p.serverSideEncryption
+	input.SSEKMSKeyId = p.kmsKeyID
+	input.SSECustomerAlgorithm = p.customerAlgorithm
+	input.SSECustomerKey = p.customerKey
+	input.SSECustomerKeyMD5 = p.customerKeyMD5
+}
+
+func (p *sseParams) applyToCreateMultipart(input *s3.CreateMultipartUploadInput) {
+	if p == nil {
+		return
+	}
+	input.ServerSideEncryption = p.serverSideEncryption
+	input.SSEKMSKeyId = p.kmsKeyID
+	input.SSECustomerAlgorithm = p.customerAlgorithm
+	input.SSECustomerKey = p.customerKey
+	input.SSECustomerKeyMD5 = p.customerKeyMD5
+}
+
+// applyToUploadPart sets only the SSE-C fields: S3 requires the same
+// customer key on every UploadPart call, but SSE-S3/KMS are fixed once at
+// CreateMultipartUpload time and must not be repeated per part.
+func (p *sseParams) applyToUploadPart(input *s3.UploadPartInput) {
+	if p == nil || p.customerKey == nil {
+		return
+	}
+	input.SSECustomerAlgorithm = p.customerAlgorithm
+	input.SSECustomerKey = p.customerKey
+	input.SSECustomerKeyMD5 = p.customerKeyMD5
+}
+
+// applyToGet sets only the SSE-C fields: a GET needs the customer key again
+// to decrypt the object, but SSE-S3/KMS need nothing from the caller.
+func (p *sseParams) applyToGet(input *s3.GetObjectInput) {
+	if p == nil || p.customerKey == nil {
+		return
+	}
+	input.SSECustomerAlgorithm = p.customerAlgorithm
+	input.SSECustomerKey = p.customerKey
+	input.SSECustomerKeyMD5 = p.customerKeyMD5
+}
+
+// applyToCopyDest applies the same fields as applyToPut: CopyObject creates
+// a new object and is encrypted exactly like a fresh PutObject.
+func (p *sseParams) applyToCopyDest(input *s3.CopyObjectInput) {
+	if p == nil {
+		return
+	}
+	input.ServerSideEncryption = p.serverSideEncryption
+	input.SSEKMSKeyId = p.kmsKeyID
+	input.SSECustomerAlgorithm = p.customerAlgorithm
+	input.SSECustomerKey = p.customerKey
+	input.SSECustomerKeyMD5 = p.customerKeyMD5
+}
+
+// applyToCopySource sets the CopySourceSSECustomerXxx fields needed to
+// decrypt an SSE-C encrypted source object during a copy. The multipart
+// temp key a pack is copied from was uploaded under the same SSE config as
+// the final object, so the same params decrypt the source here.
+func (p *sseParams) applyToCopySource(input *s3.CopyObjectInput) {
+	if p == nil || p.customerKey == nil {
+		return
+	}
+	input.CopySourceSSECustomerAlgorithm = p.customerAlgorithm
+	input.CopySourceSSECustomerKey = p.customerKey
+	input.CopySourceSSECustomerKeyMD5 = p.customerKeyMD5
+}
+
+// applyToUploadPartCopySource is applyToCopySource for the per-part copy
+// used by copyMultipart once a pack is too large for a single CopyObject.
+func (p *sseParams) applyToUploadPartCopySource(input *s3.UploadPartCopyInput) {
+	if p == nil || p.customerKey == nil {
+		return
+	}
+	input.CopySourceSSECustomerAlgorithm = p.customerAlgorithm
+	input.CopySourceSSECustomerKey = p.customerKey
+	input.CopySourceSSECustomerKeyMD5 = p.customerKeyMD5
+}
+
+// applyToUploadPartCopy sets only the destination SSE-C fields: like
+// applyToUploadPart, S3 requires the customer key repeated on every
+// UploadPartCopy call when the destination uses SSE-C.
+func (p *sseParams) applyToUploadPartCopy(input *s3.UploadPartCopyInput) {
+	if p == nil || p.customerKey == nil {
+		return
+	}
+	input.SSECustomerAlgorithm = p.customerAlgorithm
+	input.SSECustomerKey = p.customerKey
+	input.SSECustomerKeyMD5 = p.customerKeyMD5
+}
+
 // Create creates a new Blob. The data is available only after Finalize()
 // has been called on the returned Blob.
 func (be *S3Backend) Create() (backend.Blob, error) {
@@ -127,24 +879,76 @@ func (be *S3Backend) Create() (backend.Blob, error) {
 
 // Get returns a reader that yields the content stored under the given
 // name. The reader should be closed after draining it.
-func (be *S3Backend) Get(t backend.Type, name string) (io.ReadCloser, error) {
+func (be *S3Backend) Get(ctx context.Context, t backend.Type, name string) (io.ReadCloser, error) {
 	path := s3path(t, name)
-	return be.bucket.GetReader(path)
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(be.bucket),
+		Key:    aws.String(path),
+	}
+
+	// SSE-C encrypted objects must present the same key used to encrypt
+	// them or S3 refuses to serve the body.
+	sse, err := be.sseParamsFor()
+	if err != nil {
+		return nil, err
+	}
+	sse.applyToGet(input)
+
+	start := time.Now()
+	req := be.client.GetObjectRequest(input)
+	req.SetContext(ctx)
+	resp, err := req.Send()
+	if err != nil {
+		be.observe("get", t, path, 0, 0, start, err)
+		return nil, err
+	}
+	be.observe("get", t, path, aws.Int64Value(resp.ContentLength), 0, start, nil)
+
+	return resp.Body, nil
+}
+
+// getReaderWithContext skips the first offset bytes of rc (a blocking read)
+// in a goroutine and races that against ctx.Done(), closing rc in the losing
+// branch so the goroutine's read unblocks instead of leaking. Modeled after the pattern used by
+// Arvados' keepclient for wrapping blocking legacy I/O in a context.
+func getReaderWithContext(ctx context.Context, rc io.ReadCloser, offset int64) error {
+	type result struct {
+		n   int64
+		err error
+	}
+	resCh := make(chan result, 1)
+
+	go func() {
+		n, err := io.CopyN(ioutil.Discard, rc, offset)
+		resCh <- result{n, err}
+	}()
+
+	select {
+	case res := <-resCh:
+		if res.err != nil {
+			return res.err
+		}
+		if res.n != offset {
+			return fmt.Errorf("less bytes read than expected, read: %d, expected: %d", res.n, offset)
+		}
+		return nil
+	case <-ctx.Done():
+		rc.Close()
+		return ctx.Err()
+	}
 }
 
 // GetReader returns an io.ReadCloser for the Blob with the given name of
 // type t at offset and length. If length is 0, the reader reads until EOF.
-func (be *S3Backend) GetReader(t backend.Type, name string, offset, length uint) (io.ReadCloser, error) {
-	rc, err := be.Get(t, name)
+func (be *S3Backend) GetReader(ctx context.Context, t backend.Type, name string, offset, length uint) (io.ReadCloser, error) {
+	rc, err := be.Get(ctx, t, name)
 	if err != nil {
 		return nil, err
 	}
 
-	n, errc := io.CopyN(ioutil.Discard, rc, int64(offset))
-	if errc != nil {
-		return nil, errc
-	} else if n != int64(offset) {
-		return nil, fmt.Errorf("less bytes read than expected, read: %d, expected: %d", n, offset)
+	if err := getReaderWithContext(ctx, rc, int64(offset)); err != nil {
+		return nil, err
 	}
 
 	if length == 0 {
@@ -155,92 +959,245 @@ func (be *S3Backend) GetReader(t backend.Type, name string, offset, length uint)
 }
 
 // Test returns true if a blob of the given type and name exists in the backend.
-func (be *S3Backend) Test(t backend.Type, name string) (bool, error) {
-	found := false
+func (be *S3Backend) Test(ctx context.Context, t backend.Type, name string) (bool, error) {
 	path := s3path(t, name)
-	_, err := be.bucket.GetReader(path)
-	if err == nil {
-		found = true
-	}
+
+	start := time.Now()
+	req := be.client.HeadObjectRequest(&s3.HeadObjectInput{
+		Bucket: aws.String(be.bucket),
+		Key:    aws.String(path),
+	})
+	req.SetContext(ctx)
+	_, err := req.Send()
+	be.observe("head", t, path, 0, 0, start, err)
 
 	// If error, then not found
-	return found, nil
+	return err == nil, nil
 }
 
 // Remove removes the blob with the given name and type.
-func (be *S3Backend) Remove(t backend.Type, name string) error {
+func (be *S3Backend) Remove(ctx context.Context, t backend.Type, name string) error {
 	path := s3path(t, name)
-	return be.bucket.Del(path)
+
+	start := time.Now()
+	req := be.client.DeleteObjectRequest(&s3.DeleteObjectInput{
+		Bucket: aws.String(be.bucket),
+		Key:    aws.String(path),
+	})
+	req.SetContext(ctx)
+	_, err := req.Send()
+	be.observe("delete", t, path, 0, 0, start, err)
+	return err
 }
 
 // List returns a channel that yields all names of blobs of type t. A
-// goroutine is started for this. If the channel done is closed, sending
-// stops.
-func (be *S3Backend) List(t backend.Type, done <-chan struct{}) <-chan string {
+// goroutine is started for this. Cancel ctx to make the goroutine stop
+// sending and return early, including between pages of a long listing.
+func (be *S3Backend) List(ctx context.Context, t backend.Type) <-chan string {
 	ch := make(chan string)
 
 	prefix := s3path(t, "")
 
-	listresp, err := be.bucket.List(prefix, "/", "", maxKeysInList)
+	go func() {
+		defer close(ch)
 
-	if err != nil {
-		close(ch)
-		return ch
+		var token *string
+		for {
+			req := be.client.ListObjectsV2Request(&s3.ListObjectsV2Input{
+				Bucket:            aws.String(be.bucket),
+				Prefix:            aws.String(prefix),
+				Delimiter:         aws.String("/"),
+				MaxKeys:           aws.Int64(maxKeysInList),
+				ContinuationToken: token,
+			})
+			req.SetContext(ctx)
+			start := time.Now()
+			resp, err := req.Send()
+			be.observe("list", t, prefix, 0, 0, start, err)
+			if err != nil {
+				return
+			}
+
+			for _, key := range resp.Contents {
+				m := strings.TrimPrefix(aws.StringValue(key.Key), prefix)
+				if m == "" {
+					continue
+				}
+
+				select {
+				case ch <- m:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			if !aws.BoolValue(resp.IsTruncated) {
+				return
+			}
+
+			// Check ctx between pages too, so a large listing
+			// (millions of pack files) cancels promptly instead of
+			// fetching every remaining page first.
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			token = resp.NextContinuationToken
+		}
+	}()
+
+	return ch
+}
+
+const maxDeleteBatch = 1000
+const deleteMaxRetries = 5
+
+// isRetryableDeleteError reports whether err is a transient S3 error worth
+// retrying with backoff, rather than a permanent failure (bad request,
+// auth, not found).
+func isRetryableDeleteError(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+
+	switch aerr.Code() {
+	case "SlowDown", "RequestTimeout", "InternalError", "ServiceUnavailable":
+		return true
 	}
+	return false
+}
 
-	matches := make([]string, len(listresp.Contents))
-	for idx, key := range listresp.Contents {
-		matches[idx] = strings.TrimPrefix(key.Key, prefix)
+// deleteBatch deletes up to maxDeleteBatch keys of type t in a single
+// DeleteObjects call, retrying the whole batch with exponential backoff on
+// throttling or transient server errors.
+func (be *S3Backend) deleteBatch(ctx context.Context, t backend.Type, keys []string) error {
+	objects := make([]s3.ObjectIdentifier, len(keys))
+	for i, k := range keys {
+		objects[i] = s3.ObjectIdentifier{Key: aws.String(s3path(t, k))}
 	}
 
-	// Continue making requests to get full list.
-	for listresp.IsTruncated {
-		listresp, err = be.bucket.List(prefix, "/", listresp.NextMarker, maxKeysInList)
+	var lastErr error
+	backoff := time.Second
+	for attempt := 0; attempt <= deleteMaxRetries; attempt++ {
+		be.acquireConn()
+		start := time.Now()
+		req := be.client.DeleteObjectsRequest(&s3.DeleteObjectsInput{
+			Bucket: aws.String(be.bucket),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		req.SetContext(ctx)
+		resp, err := req.Send()
+		be.releaseConn()
+		be.observe("delete", t, fmt.Sprintf("%d keys", len(keys)), 0, 0, start, err)
+
 		if err != nil {
-			close(ch)
-			return ch
+			if !isRetryableDeleteError(err) {
+				return err
+			}
+			lastErr = err
+			time.Sleep(backoff)
+			backoff *= 2
+			continue
 		}
 
-		for _, key := range listresp.Contents {
-			matches = append(matches, strings.TrimPrefix(key.Key, prefix))
+		if len(resp.Errors) == 0 {
+			return nil
 		}
+
+		msgs := make([]string, len(resp.Errors))
+		for i, e := range resp.Errors {
+			msgs[i] = fmt.Sprintf("%s: %s", aws.StringValue(e.Key), aws.StringValue(e.Message))
+		}
+		return fmt.Errorf("failed to delete %d of %d keys: %s", len(resp.Errors), len(keys), strings.Join(msgs, "; "))
 	}
 
-	go func() {
-		defer close(ch)
-		for _, m := range matches {
-			if m == "" {
-				continue
+	return fmt.Errorf("giving up deleting batch after %d retries: %v", deleteMaxRetries, lastErr)
+}
+
+// removeKeys deletes all blobs of type t, fanning List() out across
+// connLimit workers that each batch up to maxDeleteBatch keys per
+// DeleteObjects call. It returns one error per failed batch rather than
+// swallowing them, so callers can tell prune/forget about partial failure.
+func (be *S3Backend) removeKeys(ctx context.Context, t backend.Type) []error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	keys := be.List(ctx, t)
+	batchCh := make(chan []string)
+
+	var wg sync.WaitGroup
+	errCh := make(chan error)
+	for i := 0; i < connLimit; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batchCh {
+				if err := be.deleteBatch(ctx, t, batch); err != nil {
+					errCh <- err
+				}
 			}
+		}()
+	}
 
-			select {
-			case ch <- m:
-			case <-done:
-				return
+	go func() {
+		defer close(batchCh)
+		batch := make([]string, 0, maxDeleteBatch)
+		for key := range keys {
+			batch = append(batch, key)
+			if len(batch) == maxDeleteBatch {
+				batchCh <- batch
+				batch = make([]string, 0, maxDeleteBatch)
 			}
 		}
+		if len(batch) > 0 {
+			batchCh <- batch
+		}
 	}()
 
-	return ch
+	// Collect errors concurrently with the workers above: with more than
+	// connLimit failed batches, a buffered-and-drained-after-wg.Wait()
+	// errCh would fill up and wedge every worker still in its range
+	// batchCh loop, which in turn means wg.Wait() below never returns.
+	var errs []error
+	collectDone := make(chan struct{})
+	go func() {
+		defer close(collectDone)
+		for err := range errCh {
+			errs = append(errs, err)
+		}
+	}()
+
+	wg.Wait()
+	close(errCh)
+	<-collectDone
+
+	return errs
 }
 
-// Remove keys for a specified backend type
-func (be *S3Backend) removeKeys(t backend.Type) {
-	doneChan := make(chan struct{})
-	for key := range be.List(backend.Data, doneChan) {
-		be.Remove(backend.Data, key)
+// Delete removes all restic keys. It returns the first error encountered
+// across all types so restic prune/forget surfaces backend problems instead
+// of silently leaving orphaned objects.
+func (be *S3Backend) Delete(ctx context.Context) error {
+	var errs []error
+	for _, t := range []backend.Type{
+		backend.Data, backend.Key, backend.Lock,
+		backend.Snapshot, backend.Index, backend.Config,
+	} {
+		errs = append(errs, be.removeKeys(ctx, t)...)
+	}
+
+	// List never yields the config object (its key is the whole prefix), so
+	// removeKeys cannot reach it; remove it directly.
+	if err := be.Remove(ctx, backend.Config, ""); err != nil {
+		errs = append(errs, err)
 	}
-	doneChan <- struct{}{}
-}
 
-// Delete removes all restic keys
-func (be *S3Backend) Delete() error {
-	be.removeKeys(backend.Data)
-	be.removeKeys(backend.Key)
-	be.removeKeys(backend.Lock)
-	be.removeKeys(backend.Snapshot)
-	be.removeKeys(backend.Index)
-	be.removeKeys(backend.Config)
+	if len(errs) > 0 {
+		return errs[0]
+	}
 	return nil
 }
 
@@ -0,0 +1,192 @@
+// Package pipe walks a directory tree and emits one Job per file or
+// directory encountered, in depth-first post-order (a directory's entries
+// are always emitted before the directory itself). Callers consume the Job
+// channel directly, or use Split to fan it out into separate channels for
+// directories and regular entries.
+package pipe
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Result is sent on Walk's result channel once the entire tree (all paths
+// passed to Walk) has been processed by the consumers of the Job channel.
+type Result struct{}
+
+// Job is either an Entry or a Dir.
+type Job interface{}
+
+// Entry is sent for a single file (or any non-directory: symlink, device,
+// ...) encountered while walking the tree.
+type Entry struct {
+	Path  string
+	Info  os.FileInfo
+	Error error
+
+	result chan<- bool
+}
+
+// Result returns the channel the consumer must send on once it is done
+// processing this Entry.
+func (e Entry) Result() chan<- bool {
+	return e.result
+}
+
+// Dir is sent once all of a directory's entries have themselves been sent
+// on the Job channel. Entries holds one receive-only channel per child
+// (file or sub-directory); a consumer handling a Dir is expected to wait on
+// all of them before declaring the directory itself done.
+type Dir struct {
+	Path  string
+	Info  os.FileInfo
+	Error error
+
+	Entries []<-chan bool
+
+	result chan<- bool
+}
+
+// Result returns the channel the consumer must send on once it is done
+// processing this Dir (i.e. once all of its Entries have been waited on).
+func (d Dir) Result() chan<- bool {
+	return d.result
+}
+
+// Walk runs filter on each file system entry found below paths and sends a
+// corresponding Job (Entry or Dir) on jobs, in depth-first post-order.
+// Walk returns once every Job has been sent and jobs has been closed; it
+// does not wait for consumers to finish processing them. Once the last Job
+// produced has been marked done via its Result() channel, a Result is sent
+// on result. Walk aborts early and returns ctx.Err() if ctx is cancelled
+// before traversal completes.
+func Walk(paths []string, filter func(string, os.FileInfo) bool, ctx context.Context, jobs chan<- Job, result chan<- Result) error {
+	defer close(jobs)
+
+	done := make([]<-chan bool, 0, len(paths))
+	for _, path := range paths {
+		ch, err := walk(path, filter, ctx, jobs)
+		if err != nil {
+			return err
+		}
+		done = append(done, ch)
+	}
+
+	go func() {
+		for _, ch := range done {
+			select {
+			case <-ch:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case result <- Result{}:
+		case <-ctx.Done():
+		}
+	}()
+
+	return nil
+}
+
+// walk processes a single path, sending one Job for it (and, recursively,
+// for everything below it if it is a directory) on jobs. It returns the
+// receive end of the Result channel that the caller must wait on to know
+// when path has been fully processed.
+func walk(path string, filter func(string, os.FileInfo) bool, ctx context.Context, jobs chan<- Job) (<-chan bool, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return sendEntry(path, info, nil, ctx, jobs)
+	}
+
+	names, err := readdirnames(path)
+	if err != nil {
+		return sendDir(path, info, err, nil, ctx, jobs)
+	}
+
+	entries := make([]<-chan bool, 0, len(names))
+	for _, name := range names {
+		childPath := filepath.Join(path, name)
+
+		childInfo, err := os.Lstat(childPath)
+		if err != nil {
+			continue
+		}
+
+		if filter != nil && !filter(childPath, childInfo) {
+			continue
+		}
+
+		ch, err := walk(childPath, filter, ctx, jobs)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, ch)
+	}
+
+	return sendDir(path, info, nil, entries, ctx, jobs)
+}
+
+func sendEntry(path string, info os.FileInfo, err error, ctx context.Context, jobs chan<- Job) (<-chan bool, error) {
+	resCh := make(chan bool, 1)
+	job := Entry{Path: path, Info: info, Error: err, result: resCh}
+
+	select {
+	case jobs <- job:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return resCh, nil
+}
+
+func sendDir(path string, info os.FileInfo, err error, entries []<-chan bool, ctx context.Context, jobs chan<- Job) (<-chan bool, error) {
+	resCh := make(chan bool, 1)
+	job := Dir{Path: path, Info: info, Error: err, Entries: entries, result: resCh}
+
+	select {
+	case jobs <- job:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return resCh, nil
+}
+
+// readdirnames returns the sorted names of path's directory entries.
+func readdirnames(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// Split reads Jobs from jobs and forwards each one to dirs or entries
+// according to its type, until jobs is closed. It does not close dirs or
+// entries; the caller does that once Split returns.
+func Split(jobs <-chan Job, dirs chan<- Dir, entries chan<- Entry) {
+	for job := range jobs {
+		switch j := job.(type) {
+		case Dir:
+			dirs <- j
+		case Entry:
+			entries <- j
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package pipe_test
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"sync"
@@ -63,7 +64,7 @@ func TestPipelineWalkerWithSplit(t *testing.T) {
 	after := stats{}
 	m := sync.Mutex{}
 
-	worker := func(wg *sync.WaitGroup, done <-chan struct{}, entCh <-chan pipe.Entry, dirCh <-chan pipe.Dir) {
+	worker := func(wg *sync.WaitGroup, ctx context.Context, entCh <-chan pipe.Entry, dirCh <-chan pipe.Dir) {
 		defer wg.Done()
 		for {
 			select {
@@ -95,7 +96,7 @@ func TestPipelineWalkerWithSplit(t *testing.T) {
 				m.Unlock()
 
 				dir.Result() <- true
-			case <-done:
+			case <-ctx.Done():
 				// pipeline was cancelled
 				return
 			}
@@ -103,13 +104,13 @@ func TestPipelineWalkerWithSplit(t *testing.T) {
 	}
 
 	var wg sync.WaitGroup
-	done := make(chan struct{})
+	ctx := context.Background()
 	entCh := make(chan pipe.Entry)
 	dirCh := make(chan pipe.Dir)
 
 	for i := 0; i < maxWorkers; i++ {
 		wg.Add(1)
-		go worker(&wg, done, entCh, dirCh)
+		go worker(&wg, ctx, entCh, dirCh)
 	}
 
 	jobs := make(chan pipe.Job, 200)
@@ -122,7 +123,7 @@ func TestPipelineWalkerWithSplit(t *testing.T) {
 	}()
 
 	resCh := make(chan pipe.Result, 1)
-	err = pipe.Walk([]string{TestWalkerPath}, acceptAll, done, jobs, resCh)
+	err = pipe.Walk([]string{TestWalkerPath}, acceptAll, ctx, jobs, resCh)
 	OK(t, err)
 
 	// wait for all workers to terminate
@@ -154,7 +155,7 @@ func TestPipelineWalker(t *testing.T) {
 	after := stats{}
 	m := sync.Mutex{}
 
-	worker := func(wg *sync.WaitGroup, done <-chan struct{}, jobs <-chan pipe.Job) {
+	worker := func(wg *sync.WaitGroup, ctx context.Context, jobs <-chan pipe.Job) {
 		defer wg.Done()
 		for {
 			select {
@@ -185,7 +186,7 @@ func TestPipelineWalker(t *testing.T) {
 					j.Result() <- true
 				}
 
-			case <-done:
+			case <-ctx.Done():
 				// pipeline was cancelled
 				return
 			}
@@ -193,16 +194,16 @@ func TestPipelineWalker(t *testing.T) {
 	}
 
 	var wg sync.WaitGroup
-	done := make(chan struct{})
+	ctx := context.Background()
 	jobs := make(chan pipe.Job)
 
 	for i := 0; i < maxWorkers; i++ {
 		wg.Add(1)
-		go worker(&wg, done, jobs)
+		go worker(&wg, ctx, jobs)
 	}
 
 	resCh := make(chan pipe.Result, 1)
-	err = pipe.Walk([]string{TestWalkerPath}, acceptAll, done, jobs, resCh)
+	err = pipe.Walk([]string{TestWalkerPath}, acceptAll, ctx, jobs, resCh)
 	OK(t, err)
 
 	// wait for all workers to terminate
@@ -225,7 +226,7 @@ func BenchmarkPipelineWalker(b *testing.B) {
 	var max time.Duration
 	m := sync.Mutex{}
 
-	fileWorker := func(wg *sync.WaitGroup, done <-chan struct{}, ch <-chan pipe.Entry) {
+	fileWorker := func(wg *sync.WaitGroup, ctx context.Context, ch <-chan pipe.Entry) {
 		defer wg.Done()
 		for {
 			select {
@@ -239,14 +240,14 @@ func BenchmarkPipelineWalker(b *testing.B) {
 				//time.Sleep(10 * time.Millisecond)
 
 				e.Result() <- true
-			case <-done:
+			case <-ctx.Done():
 				// pipeline was cancelled
 				return
 			}
 		}
 	}
 
-	dirWorker := func(wg *sync.WaitGroup, done <-chan struct{}, ch <-chan pipe.Dir) {
+	dirWorker := func(wg *sync.WaitGroup, ctx context.Context, ch <-chan pipe.Dir) {
 		defer wg.Done()
 		for {
 			select {
@@ -271,7 +272,7 @@ func BenchmarkPipelineWalker(b *testing.B) {
 				m.Unlock()
 
 				dir.Result() <- true
-			case <-done:
+			case <-ctx.Done():
 				// pipeline was cancelled
 				return
 			}
@@ -280,7 +281,7 @@ func BenchmarkPipelineWalker(b *testing.B) {
 
 	for i := 0; i < b.N; i++ {
 		max = 0
-		done := make(chan struct{})
+		ctx := context.Background()
 		entCh := make(chan pipe.Entry, 200)
 		dirCh := make(chan pipe.Dir, 200)
 
@@ -288,8 +289,8 @@ func BenchmarkPipelineWalker(b *testing.B) {
 		b.Logf("starting %d workers", maxWorkers)
 		for i := 0; i < maxWorkers; i++ {
 			wg.Add(2)
-			go dirWorker(&wg, done, dirCh)
-			go fileWorker(&wg, done, entCh)
+			go dirWorker(&wg, ctx, dirCh)
+			go fileWorker(&wg, ctx, entCh)
 		}
 
 		jobs := make(chan pipe.Job, 200)
@@ -302,7 +303,7 @@ func BenchmarkPipelineWalker(b *testing.B) {
 		}()
 
 		resCh := make(chan pipe.Result, 1)
-		err := pipe.Walk([]string{TestWalkerPath}, acceptAll, done, jobs, resCh)
+		err := pipe.Walk([]string{TestWalkerPath}, acceptAll, ctx, jobs, resCh)
 		OK(b, err)
 
 		// wait for all workers to terminate
@@ -331,7 +332,7 @@ func TestPipelineWalkerMultiple(t *testing.T) {
 	after := stats{}
 	m := sync.Mutex{}
 
-	worker := func(wg *sync.WaitGroup, done <-chan struct{}, jobs <-chan pipe.Job) {
+	worker := func(wg *sync.WaitGroup, ctx context.Context, jobs <-chan pipe.Job) {
 		defer wg.Done()
 		for {
 			select {
@@ -362,7 +363,7 @@ func TestPipelineWalkerMultiple(t *testing.T) {
 					j.Result() <- true
 				}
 
-			case <-done:
+			case <-ctx.Done():
 				// pipeline was cancelled
 				return
 			}
@@ -370,16 +371,16 @@ func TestPipelineWalkerMultiple(t *testing.T) {
 	}
 
 	var wg sync.WaitGroup
-	done := make(chan struct{})
+	ctx := context.Background()
 	jobs := make(chan pipe.Job)
 
 	for i := 0; i < maxWorkers; i++ {
 		wg.Add(1)
-		go worker(&wg, done, jobs)
+		go worker(&wg, ctx, jobs)
 	}
 
 	resCh := make(chan pipe.Result, 1)
-	err = pipe.Walk(paths, acceptAll, done, jobs, resCh)
+	err = pipe.Walk(paths, acceptAll, ctx, jobs, resCh)
 	OK(t, err)
 
 	// wait for all workers to terminate